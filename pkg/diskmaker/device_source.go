@@ -0,0 +1,208 @@
+package diskmaker
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/sys/unix"
+	"k8s.io/klog"
+)
+
+// debounceWindow coalesces a burst of device events (e.g. all the
+// partitions of a single hotplugged disk) into one reconcile call.
+var debounceWindow = 500 * time.Millisecond
+
+// resyncInterval is the slow safety-net resync that keeps running even
+// when no uevent or fsnotify event is observed, in case an event was
+// missed.
+var resyncInterval = 5 * time.Minute
+
+// deviceSource produces a coalesced stream of reconcile signals. The
+// returned channel is closed once stop fires.
+type deviceSource interface {
+	start(stop <-chan struct{}) <-chan struct{}
+	// updateStableIDRoots adds fsnotify watches on roots once a
+	// LocalVolume's StableDeviceIDRoots override is known (watches added
+	// earlier are not removed), so hotplug
+	// events under a non-default root get the same fast path as the
+	// default by-id/by-path dirs instead of waiting on the slow resync.
+	updateStableIDRoots(roots []string)
+}
+
+// udevDeviceSource watches for block device add/remove/change uevents over
+// a netlink socket, and for changes to the stable-id directories and the
+// configmap file via fsnotify, so that DiskMaker reacts to hotplug instead
+// of polling.
+type udevDeviceSource struct {
+	watchPaths  []string
+	rootUpdates chan []string
+}
+
+func newUdevDeviceSource(configLocation string, stableIDRoots []string) deviceSource {
+	watchPaths := []string{configLocation}
+	for _, root := range stableIDRoots {
+		watchPaths = append(watchPaths, root+"/*")
+	}
+	return &udevDeviceSource{watchPaths: watchPaths, rootUpdates: make(chan []string, 1)}
+}
+
+func (u *udevDeviceSource) start(stop <-chan struct{}) <-chan struct{} {
+	raw := make(chan struct{})
+	out := make(chan struct{})
+
+	go u.watchUevents(raw, stop)
+	go u.watchFsnotify(raw, stop)
+	go debounce(raw, out, debounceWindow, stop)
+
+	return out
+}
+
+// updateStableIDRoots hands watchFsnotify the latest set of stable-id
+// roots to additionally watch. The channel is a size-1 "latest wins"
+// mailbox: a pending, not-yet-applied update is replaced rather than
+// queued, since only the most recent set of roots matters.
+func (u *udevDeviceSource) updateStableIDRoots(roots []string) {
+	for {
+		select {
+		case u.rootUpdates <- roots:
+			return
+		case <-u.rootUpdates:
+		}
+	}
+}
+
+// watchUevents listens on NETLINK_KOBJECT_UEVENT for SUBSYSTEM=block
+// add/remove/change events.
+func (u *udevDeviceSource) watchUevents(out chan<- struct{}, stop <-chan struct{}) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		klog.Errorf("error opening uevent netlink socket: %v", err)
+		return
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 1}); err != nil {
+		klog.Errorf("error binding uevent netlink socket: %v", err)
+		return
+	}
+
+	go func() {
+		<-stop
+		unix.Close(fd)
+	}()
+
+	buf := make([]byte, 8192)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return
+		}
+		if !isBlockUevent(buf[:n]) {
+			continue
+		}
+		select {
+		case out <- struct{}{}:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// isBlockUevent reports whether a raw uevent message is an add, remove or
+// change event for the block subsystem.
+func isBlockUevent(msg []byte) bool {
+	fields := strings.Split(string(msg), "\x00")
+	sawBlock := false
+	sawAction := false
+	for _, field := range fields {
+		switch {
+		case field == "SUBSYSTEM=block":
+			sawBlock = true
+		case field == "ACTION=add" || field == "ACTION=remove" || field == "ACTION=change":
+			sawAction = true
+		}
+	}
+	return sawBlock && sawAction
+}
+
+// watchFsnotify watches the parent directories of the configured paths
+// (each stable-id root directory and the configmap file) for changes.
+func (u *udevDeviceSource) watchFsnotify(out chan<- struct{}, stop <-chan struct{}) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		klog.Errorf("error creating fsnotify watcher: %v", err)
+		return
+	}
+	defer watcher.Close()
+
+	for _, p := range u.watchPaths {
+		dir := filepath.Dir(p)
+		if err := watcher.Add(dir); err != nil {
+			klog.Errorf("error watching %s: %v", dir, err)
+		}
+	}
+
+	for {
+		select {
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			select {
+			case out <- struct{}{}:
+			case <-stop:
+				return
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			klog.Errorf("fsnotify error: %v", err)
+		case roots, ok := <-u.rootUpdates:
+			if !ok {
+				return
+			}
+			for _, root := range roots {
+				if err := watcher.Add(root); err != nil {
+					klog.Errorf("error watching %s: %v", root, err)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// debounce reads signals from in and forwards at most one signal to out
+// per window, so a burst of events collapses into a single reconcile.
+func debounce(in <-chan struct{}, out chan<- struct{}, window time.Duration, stop <-chan struct{}) {
+	defer close(out)
+
+	var timerC <-chan time.Time
+	timer := time.NewTimer(window)
+	if !timer.Stop() {
+		<-timer.C
+	}
+
+	for {
+		select {
+		case _, ok := <-in:
+			if !ok {
+				return
+			}
+			timer.Reset(window)
+			timerC = timer.C
+		case <-timerC:
+			timerC = nil
+			select {
+			case out <- struct{}{}:
+			case <-stop:
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
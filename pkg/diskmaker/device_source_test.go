@@ -0,0 +1,74 @@
+package diskmaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsBlockUevent(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want bool
+	}{
+		{"block add", "add@/block/sda\x00ACTION=add\x00SUBSYSTEM=block\x00", true},
+		{"block change", "change@/block/sda\x00ACTION=change\x00SUBSYSTEM=block\x00", true},
+		{"non-block subsystem", "add@/net/eth0\x00ACTION=add\x00SUBSYSTEM=net\x00", false},
+		{"block bind action", "bind@/block/sda\x00ACTION=bind\x00SUBSYSTEM=block\x00", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBlockUevent([]byte(tt.msg)); got != tt.want {
+				t.Errorf("isBlockUevent(%q) = %v, want %v", tt.msg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateStableIDRootsReplacesPendingUpdate(t *testing.T) {
+	u := &udevDeviceSource{rootUpdates: make(chan []string, 1)}
+
+	u.updateStableIDRoots([]string{"/dev/disk/by-id"})
+	u.updateStableIDRoots([]string{"/custom/by-id", "/custom/by-path"})
+
+	select {
+	case got := <-u.rootUpdates:
+		want := []string{"/custom/by-id", "/custom/by-path"}
+		if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+			t.Fatalf("expected latest update %v, got %v", want, got)
+		}
+	default:
+		t.Fatal("expected a pending update")
+	}
+
+	select {
+	case <-u.rootUpdates:
+		t.Fatal("expected only the latest update to be queued")
+	default:
+	}
+}
+
+func TestDebounceCoalescesBurst(t *testing.T) {
+	in := make(chan struct{})
+	out := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go debounce(in, out, 20*time.Millisecond, stop)
+
+	for i := 0; i < 5; i++ {
+		in <- struct{}{}
+	}
+
+	select {
+	case <-out:
+	case <-time.After(time.Second):
+		t.Fatal("expected a debounced signal")
+	}
+
+	select {
+	case <-out:
+		t.Fatal("did not expect a second signal for a single burst")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
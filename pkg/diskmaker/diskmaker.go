@@ -14,6 +14,7 @@ import (
 
 	"github.com/ghodss/yaml"
 	localv1 "github.com/openshift/local-storage-operator/pkg/apis/local/v1"
+	"github.com/openshift/local-storage-operator/pkg/diskmaker/safepath"
 	"golang.org/x/sys/unix"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -25,9 +26,17 @@ import (
 // It also ensures that only stable device names are used.
 
 var (
-	checkDuration = 5 * time.Second
-	diskByIDPath  = "/dev/disk/by-id/*"
-	rootfsDir     = "/rootfs"
+	rootfsDir = "/rootfs"
+
+	// defaultStableDeviceIDRoots is searched, in order, for a stable
+	// identifier for a device when a LocalVolume does not override it.
+	// by-id is preferred; by-path is the fallback for iSCSI/FC/virtio-scsi
+	// devices that only get a stable entry there.
+	defaultStableDeviceIDRoots = []string{"/dev/disk/by-id", "/dev/disk/by-path"}
+
+	// stableIDPreference ranks by-id entries so that, when a device has
+	// several, the more globally-stable one is symlinked.
+	stableIDPreference = []string{"wwn-", "scsi-", "nvme-eui."}
 )
 
 type DiskMaker struct {
@@ -36,6 +45,12 @@ type DiskMaker struct {
 	apiClient       apiUpdater
 	localVolume     *localv1.LocalVolume
 	eventSync       *eventReporter
+	mounter         mounter
+	loopManager     loopDeviceManager
+	deviceSource    deviceSource
+	rootfs          *safepath.SafePath
+	symlinkRoot     *safepath.SafePath
+	stableIDRoots   []string
 }
 
 type DiskLocation struct {
@@ -52,6 +67,10 @@ func NewDiskMaker(configLocation, symLinkLocation string) *DiskMaker {
 	t.symlinkLocation = symLinkLocation
 	t.apiClient = newAPIUpdater()
 	t.eventSync = newEventReporter(t.apiClient)
+	t.mounter = newBindMounter()
+	t.loopManager = newLoopDeviceManager()
+	t.stableIDRoots = defaultStableDeviceIDRoots
+	t.deviceSource = newUdevDeviceSource(configLocation, defaultStableDeviceIDRoots)
 	return t
 }
 
@@ -85,13 +104,21 @@ func (d *DiskMaker) loadConfig() (*DiskConfig, error) {
 	}
 	d.localVolume = lv
 
+	if len(diskConfig.StableDeviceIDRoots) > 0 {
+		d.stableIDRoots = diskConfig.StableDeviceIDRoots
+	} else {
+		d.stableIDRoots = defaultStableDeviceIDRoots
+	}
+
 	return &diskConfig, nil
 }
 
-// Run and create disk config
+// Run and create disk config. Reconciles are driven primarily by block
+// device uevents and by changes to the stable-id directories and configmap,
+// with a slow ticker kept only as a safety-net resync.
 func (d *DiskMaker) Run(stop <-chan struct{}) {
-	ticker := time.NewTicker(checkDuration)
-	defer ticker.Stop()
+	resyncTicker := time.NewTicker(resyncInterval)
+	defer resyncTicker.Stop()
 
 	err := os.MkdirAll(d.symlinkLocation, 0755)
 	if err != nil {
@@ -99,15 +126,31 @@ func (d *DiskMaker) Run(stop <-chan struct{}) {
 		os.Exit(-1)
 	}
 
+	rootfs, err := safepath.Open(rootfsDir)
+	if err != nil {
+		klog.Errorf("error opening %s: %v", rootfsDir, err)
+		os.Exit(-1)
+	}
+	d.rootfs = rootfs
+
+	symlinkRoot, err := safepath.Open(d.symlinkLocation)
+	if err != nil {
+		klog.Errorf("error opening %s: %v", d.symlinkLocation, err)
+		os.Exit(-1)
+	}
+	d.symlinkRoot = symlinkRoot
+
+	events := d.deviceSource.start(stop)
+
 	for {
 		select {
-		case <-ticker.C:
-			diskConfig, err := d.loadConfig()
-			if err != nil {
-				klog.Errorf("error loading configuration: %v", err)
-				break
+		case _, ok := <-events:
+			if !ok {
+				return
 			}
-			d.symLinkDisks(diskConfig)
+			d.reconcile()
+		case <-resyncTicker.C:
+			d.reconcile()
 		case <-stop:
 			klog.Infof("exiting, received message on stop channel")
 			os.Exit(0)
@@ -115,8 +158,21 @@ func (d *DiskMaker) Run(stop <-chan struct{}) {
 	}
 }
 
+func (d *DiskMaker) reconcile() {
+	diskConfig, err := d.loadConfig()
+	if err != nil {
+		klog.Errorf("error loading configuration: %v", err)
+		return
+	}
+	d.deviceSource.updateStableIDRoots(d.stableIDRoots)
+	d.symLinkDisks(diskConfig)
+}
+
 func (d *DiskMaker) symLinkDisks(diskConfig *DiskConfig) {
-	cmd := exec.Command("lsblk", "--list", "-o", "NAME,MOUNTPOINT", "--noheadings")
+	d.removeStaleBindMounts(diskConfig)
+	d.removeStaleLoopDevices(diskConfig)
+
+	cmd := exec.Command("lsblk", "-P", "-b", "-o", lsblkColumns)
 	var out bytes.Buffer
 	var err error
 	cmd.Stdout = &out
@@ -128,7 +184,7 @@ func (d *DiskMaker) symLinkDisks(diskConfig *DiskConfig) {
 		klog.Errorf(msg)
 		return
 	}
-	deviceSet, err := d.findNewDisks(out.String())
+	devices, err := parseLsblkPairs(out.String())
 	if err != nil {
 		msg := fmt.Sprintf("error reading blocklist: %v", err)
 		e := newEvent(ErrorReadingBlockList, msg, "")
@@ -136,22 +192,29 @@ func (d *DiskMaker) symLinkDisks(diskConfig *DiskConfig) {
 		klog.Errorf(msg)
 		return
 	}
+	deviceSet := candidateDeviceNames(devices)
+	deviceInfo := indexLsblkDevices(devices)
 
 	if len(deviceSet) == 0 {
 		klog.V(3).Infof("unable to find any new disks")
 	}
 
-	// read all available disks from /dev/disk/by-id/*
-	allDiskIds, err := filepath.Glob(diskByIDPath)
-	if err != nil {
-		msg := fmt.Sprintf("error listing disks in /dev/disk/by-id: %v", err)
-		e := newEvent(ErrorListingDeviceID, msg, "")
-		d.eventSync.report(e, d.localVolume)
-		klog.Errorf(msg)
-		return
+	// read all available stable device IDs, in root preference order
+	// (by-id before by-path, unless overridden).
+	var allDiskIds []string
+	for _, root := range d.stableIDRoots {
+		matches, err := filepath.Glob(path.Join(root, "*"))
+		if err != nil {
+			msg := fmt.Sprintf("error listing disks in %s: %v", root, err)
+			e := newEvent(ErrorListingDeviceID, msg, "")
+			d.eventSync.report(e, d.localVolume)
+			klog.Errorf(msg)
+			continue
+		}
+		allDiskIds = append(allDiskIds, matches...)
 	}
 
-	deviceMap, err := d.findMatchingDisks(diskConfig, deviceSet, allDiskIds)
+	deviceMap, err := d.findMatchingDisks(diskConfig, deviceSet, deviceInfo, allDiskIds)
 	if err != nil {
 		msg := fmt.Sprintf("eror finding matching disks: %v", err)
 		e := newEvent(ErrorFindingMatchingDisk, msg, "")
@@ -171,8 +234,7 @@ func (d *DiskMaker) symLinkDisks(diskConfig *DiskConfig) {
 	for storageClass, deviceArray := range deviceMap {
 		for _, deviceNameLocation := range deviceArray {
 			symLinkDirPath := path.Join(d.symlinkLocation, storageClass)
-			err := os.MkdirAll(symLinkDirPath, 0755)
-			if err != nil {
+			if err := d.symlinkRoot.MkdirAll(storageClass, 0755); err != nil {
 				msg := fmt.Sprintf("error creating symlink dir %s: %v", symLinkDirPath, err)
 				e := newEvent(ErrorFindingMatchingDisk, msg, "")
 				d.eventSync.report(e, d.localVolume)
@@ -183,36 +245,33 @@ func (d *DiskMaker) symLinkDisks(diskConfig *DiskConfig) {
 			// if it is a shared directory
 			if deviceNameLocation.directoryPath != "" {
 				bindName := generateBindName(deviceNameLocation.directoryPath, storageClass)
-				bindPath := path.Join(symLinkDirPath, bindName)
-				if fileExists(bindPath) {
-					klog.V(4).Infof("bind path %s already exists", bindPath)
-					continue
-				}
-
-				// TODO: perform actual bind mount of directoryPath to bindPath
-
+				relBindPath := path.Join(storageClass, bindName)
+				d.bindMountDir(deviceNameLocation.directoryPath, relBindPath)
+				continue
 			}
 
 			baseDeviceName := filepath.Base(deviceNameLocation.diskNamePath)
+			relSymLinkPath := path.Join(storageClass, baseDeviceName)
 			symLinkPath := path.Join(symLinkDirPath, baseDeviceName)
-			if fileExists(symLinkPath) {
+			if d.symlinkRoot.Exists(relSymLinkPath) {
 				klog.V(4).Infof("symlink %s already exists", symLinkPath)
 				continue
 			}
 			var symLinkErr error
 			if deviceNameLocation.diskID != "" {
 				klog.V(3).Infof("symlinking to %s to %s", deviceNameLocation.diskID, symLinkPath)
-				symLinkErr = os.Symlink(deviceNameLocation.diskID, symLinkPath)
+				symLinkErr = d.symlinkRoot.Symlink(deviceNameLocation.diskID, relSymLinkPath)
 			} else {
 				klog.V(3).Infof("symlinking to %s to %s", deviceNameLocation.diskNamePath, symLinkPath)
-				symLinkErr = os.Symlink(deviceNameLocation.diskNamePath, symLinkPath)
+				symLinkErr = d.symlinkRoot.Symlink(deviceNameLocation.diskNamePath, relSymLinkPath)
 			}
 
 			if symLinkErr != nil {
-				msg := fmt.Sprintf("error creating symlink %s: %v", symLinkPath, err)
+				msg := fmt.Sprintf("error creating symlink %s: %v", symLinkPath, symLinkErr)
 				e := newEvent(ErrorFindingMatchingDisk, msg, deviceNameLocation.diskNamePath)
 				d.eventSync.report(e, d.localVolume)
 				klog.Errorf(msg)
+				continue
 			}
 
 			successMsg := fmt.Sprintf("found matching disk %s", baseDeviceName)
@@ -223,7 +282,7 @@ func (d *DiskMaker) symLinkDisks(diskConfig *DiskConfig) {
 
 }
 
-func (d *DiskMaker) findMatchingDisks(diskConfig *DiskConfig, deviceSet sets.String, allDiskIds []string) (map[string][]DiskLocation, error) {
+func (d *DiskMaker) findMatchingDisks(diskConfig *DiskConfig, deviceSet sets.String, deviceInfo map[string]lsblkDevice, allDiskIds []string) (map[string][]DiskLocation, error) {
 	// blockDeviceMap is a map of storageclass and device locations
 	blockDeviceMap := make(map[string][]DiskLocation)
 
@@ -241,6 +300,13 @@ func (d *DiskMaker) findMatchingDisks(diskConfig *DiskConfig, deviceSet sets.Str
 		for _, diskName := range deviceNames {
 			baseDeviceName := filepath.Base(diskName)
 			if hasExactDisk(deviceSet, baseDeviceName) {
+				if reason, unsafe := d.deviceHasUnexpectedData(diskName, deviceInfo[baseDeviceName], disks.ForceWipe); unsafe {
+					msg := fmt.Sprintf("refusing to use %s: %s", diskName, reason)
+					e := newEvent(ErrorDeviceHasFilesystem, msg, diskName)
+					d.eventSync.report(e, d.localVolume)
+					klog.Errorf(msg)
+					continue
+				}
 				matchedDeviceID, err := d.findStableDeviceID(baseDeviceName, allDiskIds)
 				// This means no /dev/disk/by-id entry was created for requested device.
 				if err != nil {
@@ -266,79 +332,209 @@ func (d *DiskMaker) findMatchingDisks(diskConfig *DiskConfig, deviceSet sets.Str
 			}
 			baseDeviceName := filepath.Base(matchedDiskName)
 			// We need to make sure that requested device is not already mounted.
-			if hasExactDisk(deviceSet, baseDeviceName) {
-				addDiskToMap(storageClass, matchedDeviceID, matchedDiskName, "")
+			if !hasExactDisk(deviceSet, baseDeviceName) {
+				continue
 			}
+			if reason, unsafe := d.deviceHasUnexpectedData(matchedDiskName, deviceInfo[baseDeviceName], disks.ForceWipe); unsafe {
+				msg := fmt.Sprintf("refusing to use %s: %s", matchedDiskName, reason)
+				e := newEvent(ErrorDeviceHasFilesystem, msg, matchedDiskName)
+				d.eventSync.report(e, d.localVolume)
+				klog.Errorf(msg)
+				continue
+			}
+			addDiskToMap(storageClass, matchedDeviceID, matchedDiskName, "")
 		}
 
 		for _, directory := range disks.DirectoryPaths {
-			sharedDirPath := path.Join(rootfsDir, directory)
-			if fileExists(sharedDirPath) {
-				isDir, err := isDir(sharedDirPath)
-				if err != nil {
-					msg := fmt.Sprintf("error checking shared dir %s: %v", sharedDirPath, err)
-					e := newEvent(ErrorCreatingSharedDir, msg, "")
-					d.eventSync.report(e, d.localVolume)
-					klog.Errorf(msg)
-				}
-				if isDir {
-					addDiskToMap(storageClass, "", "", sharedDirPath)
-				}
+			// directory is resolved through d.rootfs rather than joined
+			// with rootfsDir and handed to os.Stat/os.MkdirAll directly,
+			// so that a symlink swapped in along the path is rejected
+			// instead of silently followed outside of rootfsDir.
+			isSharedDir, err := d.rootfs.IsDir(directory)
+			if err != nil {
+				msg := fmt.Sprintf("error checking shared dir %s: %v", directory, err)
+				e := newEvent(ErrorCreatingSharedDir, msg, "")
+				d.eventSync.report(e, d.localVolume)
+				klog.Errorf(msg)
+				continue
+			}
+			if isSharedDir {
+				addDiskToMap(storageClass, "", "", directory)
+				continue
+			}
+			if d.rootfs.Exists(directory) {
+				msg := fmt.Sprintf("shared dir %s exists but is not a directory", directory)
+				e := newEvent(ErrorCreatingSharedDir, msg, "")
+				d.eventSync.report(e, d.localVolume)
+				klog.Errorf(msg)
 				continue
 			}
 
-			err := os.MkdirAll(sharedDirPath, 0755)
-			if err != nil {
-				msg := fmt.Sprintf("error creating shared dir %s: %v", sharedDirPath, err)
+			if err := d.rootfs.MkdirAll(directory, 0755); err != nil {
+				msg := fmt.Sprintf("error creating shared dir %s: %v", directory, err)
 				e := newEvent(ErrorCreatingSharedDir, msg, "")
 				d.eventSync.report(e, d.localVolume)
 				klog.Errorf(msg)
 				continue
 			}
-			addDiskToMap(storageClass, "", "", sharedDirPath)
+			addDiskToMap(storageClass, "", "", directory)
+		}
+
+		for _, filePath := range disks.FilePaths {
+			if !d.rootfs.Exists(filePath) {
+				msg := fmt.Sprintf("backing file %s does not exist", filePath)
+				e := newEvent(ErrorCreatingLoopDevice, msg, "")
+				d.eventSync.report(e, d.localVolume)
+				klog.Errorf(msg)
+				continue
+			}
+
+			sharedFilePath := path.Join(rootfsDir, filePath)
+			resolvedPath, closeFile, err := d.rootfs.ProcPath(filePath)
+			if err != nil {
+				msg := fmt.Sprintf("error resolving backing file %s: %v", sharedFilePath, err)
+				e := newEvent(ErrorCreatingLoopDevice, msg, "")
+				d.eventSync.report(e, d.localVolume)
+				klog.Errorf(msg)
+				continue
+			}
+			loopDevice, err := d.loopManager.attach(storageClass, sharedFilePath, resolvedPath)
+			closeFile()
+			if err != nil {
+				msg := fmt.Sprintf("error attaching loop device for %s: %v", sharedFilePath, err)
+				e := newEvent(ErrorCreatingLoopDevice, msg, "")
+				d.eventSync.report(e, d.localVolume)
+				klog.Errorf(msg)
+				continue
+			}
+			addDiskToMap(storageClass, "", loopDevice, "")
 		}
 	}
 	return blockDeviceMap, nil
 }
 
+// removeStaleLoopDevices detaches loop devices whose backing file is no
+// longer present in diskConfig, so that a file removed from the
+// LocalVolume config gets its loop device torn down.
+func (d *DiskMaker) removeStaleLoopDevices(diskConfig *DiskConfig) {
+	wanted := sets.NewString()
+	for storageClass, disks := range diskConfig.Disks {
+		for _, filePath := range disks.FilePaths {
+			wanted.Insert(loopKey(storageClass, path.Join(rootfsDir, filePath)))
+		}
+	}
+
+	state, err := d.loopManager.list()
+	if err != nil {
+		klog.Errorf("error listing loop device state: %v", err)
+		return
+	}
+
+	for key := range state {
+		if wanted.Has(key) {
+			continue
+		}
+		storageClass, filePath, err := splitLoopKey(key)
+		if err != nil {
+			klog.Errorf("%v", err)
+			continue
+		}
+		if err := d.loopManager.detach(storageClass, filePath); err != nil {
+			msg := fmt.Sprintf("error detaching stale loop device for %s: %v", filePath, err)
+			e := newEvent(ErrorCreatingLoopDevice, msg, "")
+			d.eventSync.report(e, d.localVolume)
+			klog.Errorf(msg)
+			continue
+		}
+		klog.V(3).Infof("detached stale loop device for %s", filePath)
+	}
+}
+
 // findDeviceByID finds device ID and return (deviceID, deviceName, error)
+// findDeviceByID resolves deviceID to its real device path. deviceID may
+// be a full path (e.g. "/dev/disk/by-id/wwn-...") or, for a
+// LocalVolume that specifies just the stable-id's basename, a bare name
+// that is looked up under each of d.stableIDRoots in order.
 func (d *DiskMaker) findDeviceByID(deviceID string) (string, string, error) {
-	diskDevPath, err := filepath.EvalSymlinks(deviceID)
-	if err != nil {
-		return "", "", fmt.Errorf("unable to find device with id %s", deviceID)
+	if filepath.IsAbs(deviceID) {
+		diskDevPath, err := filepath.EvalSymlinks(deviceID)
+		if err != nil {
+			return "", "", fmt.Errorf("unable to find device with id %s", deviceID)
+		}
+		return deviceID, diskDevPath, nil
 	}
-	return deviceID, diskDevPath, nil
+
+	for _, root := range d.stableIDRoots {
+		candidate := path.Join(root, deviceID)
+		diskDevPath, err := filepath.EvalSymlinks(candidate)
+		if err != nil {
+			continue
+		}
+		return candidate, diskDevPath, nil
+	}
+	return "", "", fmt.Errorf("unable to find device with id %s", deviceID)
 }
 
+// findStableDeviceID returns the stable-id path for diskName, preferring
+// (in order) a wwn-, then scsi-, then nvme-eui. prefixed entry when
+// several by-id/by-path entries resolve to the same disk, and otherwise
+// falling back to whichever matched first in root-preference order.
 func (d *DiskMaker) findStableDeviceID(diskName string, allDisks []string) (string, error) {
+	var matches []string
 	for _, diskIDPath := range allDisks {
 		diskDevPath, err := filepath.EvalSymlinks(diskIDPath)
 		if err != nil {
 			continue
 		}
-		diskDevName := filepath.Base(diskDevPath)
-		if diskDevName == diskName {
-			return diskIDPath, nil
+		if filepath.Base(diskDevPath) == diskName {
+			matches = append(matches, diskIDPath)
 		}
 	}
-	return "", fmt.Errorf("unable to find ID of disk %s", diskName)
+	if len(matches) == 0 {
+		return "", fmt.Errorf("unable to find ID of disk %s", diskName)
+	}
+	return preferStableID(matches), nil
 }
 
-func (d *DiskMaker) findNewDisks(content string) (sets.String, error) {
-	deviceSet := sets.NewString()
-	deviceLines := strings.Split(content, "\n")
-	for _, deviceLine := range deviceLines {
-		deviceLine := strings.TrimSpace(deviceLine)
-		deviceDetails := strings.Split(deviceLine, " ")
-		// We only consider devices that are not mounted.
-		// TODO: We should also consider checking for device partitions, so as
-		// if a device has partitions then we do not consider the device. We only
-		// consider partitions.
-		if len(deviceDetails) == 1 && len(deviceDetails[0]) > 0 {
-			deviceSet.Insert(deviceDetails[0])
+// preferStableID picks the most globally-stable identifier out of a set
+// of paths that all resolve to the same device.
+func preferStableID(candidates []string) string {
+	for _, prefix := range stableIDPreference {
+		for _, candidate := range candidates {
+			if strings.HasPrefix(filepath.Base(candidate), prefix) {
+				return candidate
+			}
 		}
 	}
-	return deviceSet, nil
+	return candidates[0]
+}
+
+// deviceHasUnexpectedData reports whether devicePath should be refused
+// because it carries a filesystem/RAID/LVM signature: lsblk itself
+// reported a non-empty FSTYPE, lsblk reported a PARTTYPE known to carry
+// data even without a probeable filesystem (e.g. a RAID member), or a
+// raw scan of the first 4KiB turns up a known signature. forceWipe opts
+// a storage class out of this check entirely.
+func (d *DiskMaker) deviceHasUnexpectedData(devicePath string, info lsblkDevice, forceWipe bool) (reason string, unsafe bool) {
+	if forceWipe {
+		return "", false
+	}
+	if info.FSType != "" {
+		return fmt.Sprintf("lsblk reports FSTYPE=%s", info.FSType), true
+	}
+	if label := partitionTypeSignature(info.PartType); label != "" {
+		return fmt.Sprintf("lsblk reports PARTTYPE=%s (%s)", info.PartType, label), true
+	}
+
+	sig, err := scanDeviceSignature(devicePath)
+	if err != nil {
+		klog.Errorf("error scanning %s for filesystem signatures: %v", devicePath, err)
+		return "", false
+	}
+	if sig != "" {
+		return fmt.Sprintf("found %s signature on device", sig), true
+	}
+	return "", false
 }
 
 func hasExactDisk(disks sets.String, device string) bool {
@@ -370,20 +566,114 @@ func isBlock(fullPath string) (bool, error) {
 	return (st.Mode & unix.S_IFMT) == unix.S_IFBLK, nil
 }
 
-// isDir checks if the given path is a directory
-func isDir(fullPath string) (bool, error) {
-	dir, err := os.Open(fullPath)
+// bindMountDir bind mounts the directory at sourceDir (relative to
+// d.rootfs) onto relBindPath (relative to d.symlinkRoot), creating
+// relBindPath if necessary and skipping the mount if it already exists
+// so that repeated reconciles are idempotent. sourceDir is resolved
+// through d.rootfs and the mount uses the resolved /proc/self/fd source
+// path rather than a plain joined path, so a symlink swap along sourceDir
+// after the check cannot redirect the mount's source. relBindPath is
+// created through d.symlinkRoot, which rejects a symlinked component, but
+// the mount target itself is the plain joined path under symlinkLocation.
+func (d *DiskMaker) bindMountDir(sourceDir, relBindPath string) {
+	bindPath := path.Join(d.symlinkLocation, relBindPath)
+
+	mounted, err := d.mounter.isMounted(bindPath)
 	if err != nil {
-		return false, err
+		msg := fmt.Sprintf("error checking mount state of %s: %v", bindPath, err)
+		e := newEvent(ErrorBindMount, msg, sourceDir)
+		d.eventSync.report(e, d.localVolume)
+		klog.Errorf(msg)
+		return
+	}
+	if mounted {
+		klog.V(4).Infof("bind path %s is already mounted", bindPath)
+		return
 	}
-	defer dir.Close()
 
-	stat, err := dir.Stat()
+	if err := d.symlinkRoot.MkdirAll(relBindPath, 0755); err != nil {
+		msg := fmt.Sprintf("error creating bind mount target %s: %v", bindPath, err)
+		e := newEvent(ErrorBindMount, msg, sourceDir)
+		d.eventSync.report(e, d.localVolume)
+		klog.Errorf(msg)
+		return
+	}
+
+	sourceProcPath, closeSource, err := d.rootfs.ProcPath(sourceDir)
 	if err != nil {
-		return false, err
+		msg := fmt.Sprintf("error resolving shared dir %s: %v", sourceDir, err)
+		e := newEvent(ErrorBindMount, msg, sourceDir)
+		d.eventSync.report(e, d.localVolume)
+		klog.Errorf(msg)
+		return
+	}
+	defer closeSource()
+
+	// No explicit chown of bindPath is needed: a successful bind mount
+	// replaces bindPath's entire view, ownership included, with the
+	// source directory's, so anything set on the pre-mount directory
+	// would be invisible once mounted.
+	if err := d.mounter.bindMount(sourceProcPath, bindPath); err != nil {
+		msg := fmt.Sprintf("error bind mounting %s to %s: %v", sourceDir, bindPath, err)
+		e := newEvent(ErrorBindMount, msg, sourceDir)
+		d.eventSync.report(e, d.localVolume)
+		klog.Errorf(msg)
+		return
+	}
+
+	successMsg := fmt.Sprintf("bind mounted %s to %s", sourceDir, bindPath)
+	e := newSuccessEvent(SuccessBindMount, successMsg, sourceDir)
+	d.eventSync.report(e, d.localVolume)
+}
+
+// removeStaleBindMounts unmounts bind mount targets under symlinkLocation
+// that no longer correspond to a directoryPath in diskConfig, so that
+// directories removed from the LocalVolume config get cleaned up.
+func (d *DiskMaker) removeStaleBindMounts(diskConfig *DiskConfig) {
+	wantedBindPaths := sets.NewString()
+	for storageClass, disks := range diskConfig.Disks {
+		for _, directory := range disks.DirectoryPaths {
+			bindName := generateBindName(directory, storageClass)
+			wantedBindPaths.Insert(path.Join(d.symlinkLocation, storageClass, bindName))
+		}
 	}
 
-	return stat.IsDir(), nil
+	storageClassDirs, err := ioutil.ReadDir(d.symlinkLocation)
+	if err != nil {
+		return
+	}
+	for _, scDir := range storageClassDirs {
+		if !scDir.IsDir() {
+			continue
+		}
+		scDirPath := path.Join(d.symlinkLocation, scDir.Name())
+		bindDirs, err := ioutil.ReadDir(scDirPath)
+		if err != nil {
+			continue
+		}
+		for _, bindDir := range bindDirs {
+			if !strings.HasPrefix(bindDir.Name(), "local-shared-") {
+				continue
+			}
+			bindPath := path.Join(scDirPath, bindDir.Name())
+			if wantedBindPaths.Has(bindPath) {
+				continue
+			}
+
+			mounted, err := d.mounter.isMounted(bindPath)
+			if err != nil || !mounted {
+				continue
+			}
+			if err := d.mounter.unmount(bindPath); err != nil {
+				msg := fmt.Sprintf("error unmounting stale bind mount %s: %v", bindPath, err)
+				e := newEvent(ErrorBindMount, msg, "")
+				d.eventSync.report(e, d.localVolume)
+				klog.Errorf(msg)
+				continue
+			}
+			klog.V(3).Infof("unmounted stale bind mount %s", bindPath)
+		}
+	}
 }
 
 func generateBindName(file, class string) string {
@@ -0,0 +1,84 @@
+package diskmaker
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/openshift/local-storage-operator/pkg/diskmaker/safepath"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestFindMatchingDisksRejectsSymlinkedSharedDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	rootfsDir := path.Join(tmpDir, "rootfs")
+	outside := t.TempDir()
+
+	if err := os.MkdirAll(rootfsDir, 0755); err != nil {
+		t.Fatalf("error creating rootfs dir: %v", err)
+	}
+	// Hostile tree: the configured shared directory is actually a symlink
+	// pointing outside of rootfsDir.
+	if err := os.Symlink(outside, path.Join(rootfsDir, "shared")); err != nil {
+		t.Fatalf("error creating symlink fixture: %v", err)
+	}
+
+	rootfs, err := safepath.Open(rootfsDir)
+	if err != nil {
+		t.Fatalf("error opening rootfs: %v", err)
+	}
+	defer rootfs.Close()
+
+	d := &DiskMaker{
+		apiClient: &fakeAPIUpdater{},
+		rootfs:    rootfs,
+	}
+	d.eventSync = newEventReporter(d.apiClient)
+
+	diskConfig := &DiskConfig{
+		Disks: map[string]Disks{
+			"sc1": {DirectoryPaths: []string{"shared"}},
+		},
+	}
+
+	deviceMap, err := d.findMatchingDisks(diskConfig, sets.NewString(), map[string]lsblkDevice{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(deviceMap["sc1"]) != 0 {
+		t.Fatalf("expected symlinked shared dir to be rejected, got %v", deviceMap["sc1"])
+	}
+
+	if _, statErr := os.Stat(path.Join(outside, "anything")); !os.IsNotExist(statErr) {
+		t.Fatalf("expected nothing created outside rootfs")
+	}
+}
+
+func TestDeviceHasUnexpectedDataChecksPartType(t *testing.T) {
+	tmpDir := t.TempDir()
+	devicePath := path.Join(tmpDir, "fakedev")
+	if err := os.WriteFile(devicePath, make([]byte, 4096), 0644); err != nil {
+		t.Fatalf("unexpected error writing fake device: %v", err)
+	}
+
+	d := &DiskMaker{}
+
+	info := lsblkDevice{PartType: "a19d880f-05fc-4d3b-a006-743f0f84911e"}
+	reason, unsafe := d.deviceHasUnexpectedData(devicePath, info, false)
+	if !unsafe {
+		t.Fatalf("expected a Linux RAID member PARTTYPE to be flagged unsafe")
+	}
+	if reason == "" {
+		t.Fatalf("expected a reason to be reported")
+	}
+
+	if _, unsafe := d.deviceHasUnexpectedData(devicePath, info, true); unsafe {
+		t.Fatalf("expected forceWipe to bypass the PARTTYPE check")
+	}
+
+	plain := lsblkDevice{PartType: "0fc63daf-8483-4772-8e79-3d69d8477de4"}
+	if _, unsafe := d.deviceHasUnexpectedData(devicePath, plain, false); unsafe {
+		t.Fatalf("expected a plain Linux filesystem PARTTYPE not to be flagged")
+	}
+}
@@ -0,0 +1,138 @@
+package diskmaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+const (
+	// ErrorCreatingLoopDevice is raised when a file cannot be attached to a
+	// loop device.
+	ErrorCreatingLoopDevice = "ErrorCreatingLoopDevice"
+)
+
+// loopStateFilePath records the storage-class/file to loop-device mapping
+// so that a diskmaker restart reuses the same loop device for a file
+// instead of attaching it a second time.
+var loopStateFilePath = "/var/lib/local-storage-operator/loop-devices.json"
+
+// loopDeviceManager attaches regular files to loop devices and keeps track
+// of the assignment so that restarts and removals are idempotent.
+type loopDeviceManager interface {
+	// attach returns the loop device backing filePath, allocating one via
+	// losetup if it is not already attached. filePath keys the persisted
+	// state and must stay stable across restarts; resolvedPath is what is
+	// actually handed to losetup, so callers resolving filePath through a
+	// TOCTOU-safe path (e.g. a /proc/self/fd entry) can pass that instead
+	// of the plain joined path without losing idempotency.
+	attach(storageClass, filePath, resolvedPath string) (string, error)
+	// detach tears down the loop device backing filePath, if any.
+	detach(storageClass, filePath string) error
+	// list returns the current storageClass|filePath -> loop device mapping.
+	list() (map[string]string, error)
+}
+
+type losetupManager struct {
+	stateFilePath string
+}
+
+func newLoopDeviceManager() loopDeviceManager {
+	return &losetupManager{stateFilePath: loopStateFilePath}
+}
+
+func loopKey(storageClass, filePath string) string {
+	return storageClass + "|" + filePath
+}
+
+func splitLoopKey(key string) (storageClass, filePath string, err error) {
+	parts := strings.SplitN(key, "|", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("malformed loop device state key %q", key)
+	}
+	return parts[0], parts[1], nil
+}
+
+func (m *losetupManager) loadState() (map[string]string, error) {
+	state := map[string]string{}
+	content, err := ioutil.ReadFile(m.stateFilePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", m.stateFilePath, err)
+	}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("error unmarshalling %s: %v", m.stateFilePath, err)
+	}
+	return state, nil
+}
+
+func (m *losetupManager) saveState(state map[string]string) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error marshalling loop device state: %v", err)
+	}
+	stateDir := filepath.Dir(m.stateFilePath)
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %v", stateDir, err)
+	}
+	if err := ioutil.WriteFile(m.stateFilePath, content, 0600); err != nil {
+		return fmt.Errorf("error writing %s: %v", m.stateFilePath, err)
+	}
+	return nil
+}
+
+func (m *losetupManager) attach(storageClass, filePath, resolvedPath string) (string, error) {
+	state, err := m.loadState()
+	if err != nil {
+		return "", err
+	}
+
+	key := loopKey(storageClass, filePath)
+	if loopDevice, ok := state[key]; ok && fileExists(loopDevice) {
+		return loopDevice, nil
+	}
+
+	out, err := exec.Command("losetup", "-f", "--show", resolvedPath).Output()
+	if err != nil {
+		return "", fmt.Errorf("error running losetup for %s: %v", filePath, err)
+	}
+	loopDevice := strings.TrimSpace(string(out))
+
+	state[key] = loopDevice
+	if err := m.saveState(state); err != nil {
+		klog.Errorf("error persisting loop device state for %s: %v", filePath, err)
+	}
+	return loopDevice, nil
+}
+
+func (m *losetupManager) detach(storageClass, filePath string) error {
+	state, err := m.loadState()
+	if err != nil {
+		return err
+	}
+
+	key := loopKey(storageClass, filePath)
+	loopDevice, ok := state[key]
+	if !ok {
+		return nil
+	}
+
+	if err := exec.Command("losetup", "-d", loopDevice).Run(); err != nil {
+		return fmt.Errorf("error detaching loop device %s: %v", loopDevice, err)
+	}
+
+	delete(state, key)
+	return m.saveState(state)
+}
+
+func (m *losetupManager) list() (map[string]string, error) {
+	return m.loadState()
+}
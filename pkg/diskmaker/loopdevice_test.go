@@ -0,0 +1,49 @@
+package diskmaker
+
+import (
+	"path"
+	"testing"
+)
+
+func TestLoopKeyRoundTrip(t *testing.T) {
+	storageClass := "local-sc"
+	filePath := "/rootfs/images/disk1.img"
+
+	key := loopKey(storageClass, filePath)
+	gotSC, gotPath, err := splitLoopKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error splitting key %q: %v", key, err)
+	}
+	if gotSC != storageClass {
+		t.Errorf("expected storage class %s, got %s", storageClass, gotSC)
+	}
+	if gotPath != filePath {
+		t.Errorf("expected file path %s, got %s", filePath, gotPath)
+	}
+}
+
+func TestLosetupManagerStatePersistence(t *testing.T) {
+	tmpDir := t.TempDir()
+	m := &losetupManager{stateFilePath: path.Join(tmpDir, "loop-devices.json")}
+
+	state, err := m.loadState()
+	if err != nil {
+		t.Fatalf("unexpected error loading empty state: %v", err)
+	}
+	if len(state) != 0 {
+		t.Fatalf("expected empty state, got %v", state)
+	}
+
+	state[loopKey("sc1", "/rootfs/a.img")] = "/dev/loop0"
+	if err := m.saveState(state); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+
+	reloaded, err := m.loadState()
+	if err != nil {
+		t.Fatalf("unexpected error reloading state: %v", err)
+	}
+	if reloaded[loopKey("sc1", "/rootfs/a.img")] != "/dev/loop0" {
+		t.Fatalf("expected persisted loop device, got %v", reloaded)
+	}
+}
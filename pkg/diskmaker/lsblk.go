@@ -0,0 +1,187 @@
+package diskmaker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// ErrorDeviceHasFilesystem is raised when a candidate device carries a
+	// recognized filesystem/RAID/LVM signature and forceWipe was not set.
+	ErrorDeviceHasFilesystem = "ErrorDeviceHasFilesystem"
+)
+
+// lsblkColumns is passed to lsblk -P so that, alongside NAME and
+// MOUNTPOINT, we also learn each device's parent (PKNAME) - needed to
+// tell a whole disk from its partitions - and its reported filesystem
+// signature.
+var lsblkColumns = "NAME,KNAME,PKNAME,TYPE,MOUNTPOINT,FSTYPE,PARTTYPE,RO,SIZE"
+
+var lsblkPairRegexp = regexp.MustCompile(`([A-Z]+)="([^"]*)"`)
+
+// lsblkDevice is one line of `lsblk -P -o` output.
+type lsblkDevice struct {
+	Name       string
+	KName      string
+	PKName     string
+	Type       string
+	MountPoint string
+	FSType     string
+	PartType   string
+	ReadOnly   bool
+	Size       int64
+}
+
+// parseLsblkPairs parses the output of `lsblk -P -o <lsblkColumns>`.
+func parseLsblkPairs(content string) ([]lsblkDevice, error) {
+	var devices []lsblkDevice
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := map[string]string{}
+		for _, match := range lsblkPairRegexp.FindAllStringSubmatch(line, -1) {
+			fields[match[1]] = match[2]
+		}
+		if fields["NAME"] == "" {
+			continue
+		}
+
+		var size int64
+		if fields["SIZE"] != "" {
+			parsed, err := strconv.ParseInt(fields["SIZE"], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing SIZE in lsblk line %q: %v", line, err)
+			}
+			size = parsed
+		}
+
+		devices = append(devices, lsblkDevice{
+			Name:       fields["NAME"],
+			KName:      fields["KNAME"],
+			PKName:     fields["PKNAME"],
+			Type:       fields["TYPE"],
+			MountPoint: fields["MOUNTPOINT"],
+			FSType:     fields["FSTYPE"],
+			PartType:   fields["PARTTYPE"],
+			ReadOnly:   fields["RO"] == "1",
+			Size:       size,
+		})
+	}
+	return devices, nil
+}
+
+// candidateDeviceNames returns the set of device names that are eligible
+// to be considered at all: unmounted, and - when a whole disk has
+// partitions - only the partitions, never the parent disk.
+func candidateDeviceNames(devices []lsblkDevice) sets.String {
+	hasChildren := sets.NewString()
+	for _, dev := range devices {
+		if dev.PKName != "" {
+			hasChildren.Insert(dev.PKName)
+		}
+	}
+
+	candidates := sets.NewString()
+	for _, dev := range devices {
+		if dev.MountPoint != "" {
+			continue
+		}
+		if dev.Type == "disk" && hasChildren.Has(dev.KName) {
+			// sda has partitions sda1/sda2: only offer the partitions.
+			continue
+		}
+		candidates.Insert(dev.Name)
+	}
+	return candidates
+}
+
+// indexLsblkDevices indexes devices by NAME for later signature lookups.
+func indexLsblkDevices(devices []lsblkDevice) map[string]lsblkDevice {
+	byName := make(map[string]lsblkDevice, len(devices))
+	for _, dev := range devices {
+		byName[dev.Name] = dev
+	}
+	return byName
+}
+
+// knownDataPartitionTypes maps GPT partition-type GUIDs and MBR
+// partition-type codes (lower-cased) to a human-readable label, for
+// partition types that imply the partition already holds data even when
+// FSTYPE comes back empty (e.g. a RAID member whose superblock blkid
+// doesn't probe as a filesystem).
+var knownDataPartitionTypes = map[string]string{
+	// GPT
+	"a19d880f-05fc-4d3b-a006-743f0f84911e": "Linux RAID member",
+	"e6d6d379-f507-44c2-a23c-238f2a3df928": "Linux LVM member",
+	"0657fd6d-a4ab-43c4-84e5-0933c84b4f4f": "Linux swap",
+	// MBR
+	"82": "Linux swap",
+	"8e": "Linux LVM member",
+	"fd": "Linux raid autodetect",
+}
+
+// partitionTypeSignature returns the label for partType if it is a known
+// data-bearing partition type, or "" otherwise.
+func partitionTypeSignature(partType string) string {
+	if partType == "" {
+		return ""
+	}
+	return knownDataPartitionTypes[strings.ToLower(partType)]
+}
+
+// filesystemSignature is a best-effort, offset-based magic number check
+// used to catch a filesystem lsblk did not report (e.g. stale udev/blkid
+// cache). It only covers signatures reliably present in the first 4KiB
+// of a device; LVM2_member and linux_raid_member in particular are
+// caught far more reliably by lsblk's own FSTYPE reporting and the
+// PARTTYPE check in deviceHasUnexpectedData than by a raw scan, so this
+// is a supplement to, not a replacement for, those checks.
+type filesystemSignature struct {
+	name   string
+	offset int
+	magic  []byte
+}
+
+var knownFilesystemSignatures = []filesystemSignature{
+	{name: "xfs", offset: 0, magic: []byte("XFSB")},
+	{name: "ext4", offset: 1080, magic: []byte{0x53, 0xef}},
+	{name: "LVM2_member", offset: 536, magic: []byte("LVM2 001")},
+}
+
+// scanDeviceSignature opens devicePath O_RDONLY, reads the first 4KiB and
+// checks it against knownFilesystemSignatures, returning the name of the
+// first one found, or "" if none match.
+func scanDeviceSignature(devicePath string) (string, error) {
+	f, err := os.OpenFile(devicePath, os.O_RDONLY, 0)
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %v", devicePath, err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, 4096)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("error reading %s: %v", devicePath, err)
+	}
+	buf = buf[:n]
+
+	for _, sig := range knownFilesystemSignatures {
+		if len(buf) < sig.offset+len(sig.magic) {
+			continue
+		}
+		if bytes.Equal(buf[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			return sig.name, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,84 @@
+package diskmaker
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+const sampleLsblkOutput = `NAME="sda" KNAME="sda" PKNAME="" TYPE="disk" MOUNTPOINT="" FSTYPE="" PARTTYPE="" RO="0" SIZE="107374182400"
+NAME="sda1" KNAME="sda1" PKNAME="sda" TYPE="part" MOUNTPOINT="" FSTYPE="ext4" PARTTYPE="" RO="0" SIZE="53687091200"
+NAME="sda2" KNAME="sda2" PKNAME="sda" TYPE="part" MOUNTPOINT="" FSTYPE="" PARTTYPE="" RO="0" SIZE="53687091200"
+NAME="sdb" KNAME="sdb" PKNAME="" TYPE="disk" MOUNTPOINT="" FSTYPE="" PARTTYPE="" RO="0" SIZE="107374182400"
+NAME="sdc" KNAME="sdc" PKNAME="" TYPE="disk" MOUNTPOINT="/mnt/data" FSTYPE="xfs" PARTTYPE="" RO="0" SIZE="107374182400"
+`
+
+func TestParseLsblkPairs(t *testing.T) {
+	devices, err := parseLsblkPairs(sampleLsblkOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(devices) != 5 {
+		t.Fatalf("expected 5 devices, got %d", len(devices))
+	}
+	if devices[1].Name != "sda1" || devices[1].PKName != "sda" || devices[1].FSType != "ext4" {
+		t.Fatalf("unexpected parse of sda1: %+v", devices[1])
+	}
+}
+
+func TestCandidateDeviceNamesSkipsParentWithPartitions(t *testing.T) {
+	devices, err := parseLsblkPairs(sampleLsblkOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	candidates := candidateDeviceNames(devices)
+
+	if candidates.Has("sda") {
+		t.Fatalf("expected sda to be excluded since it has partitions")
+	}
+	if !candidates.Has("sda1") || !candidates.Has("sda2") {
+		t.Fatalf("expected sda1 and sda2 to be candidates, got %v", candidates.List())
+	}
+	if !candidates.Has("sdb") {
+		t.Fatalf("expected whole disk sdb (no partitions) to be a candidate")
+	}
+	if candidates.Has("sdc") {
+		t.Fatalf("expected mounted sdc to be excluded")
+	}
+}
+
+func TestScanDeviceSignatureDetectsXFS(t *testing.T) {
+	tmpDir := t.TempDir()
+	devicePath := path.Join(tmpDir, "fakedev")
+
+	buf := make([]byte, 4096)
+	copy(buf, []byte("XFSB"))
+	if err := os.WriteFile(devicePath, buf, 0644); err != nil {
+		t.Fatalf("unexpected error writing fake device: %v", err)
+	}
+
+	sig, err := scanDeviceSignature(devicePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sig != "xfs" {
+		t.Fatalf("expected xfs signature, got %q", sig)
+	}
+}
+
+func TestScanDeviceSignatureNoneFound(t *testing.T) {
+	tmpDir := t.TempDir()
+	devicePath := path.Join(tmpDir, "fakedev")
+
+	if err := os.WriteFile(devicePath, make([]byte, 4096), 0644); err != nil {
+		t.Fatalf("unexpected error writing fake device: %v", err)
+	}
+
+	sig, err := scanDeviceSignature(devicePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sig != "" {
+		t.Fatalf("expected no signature, got %q", sig)
+	}
+}
@@ -0,0 +1,93 @@
+package diskmaker
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// ErrorBindMount is raised when a directory fails to bind mount, or an
+	// existing bind mount cannot be torn down.
+	ErrorBindMount = "ErrorBindMount"
+	// SuccessBindMount is raised once a directory has been bind mounted.
+	SuccessBindMount = "SuccessBindMount"
+)
+
+// mounter abstracts bind mount operations so that symLinkDisks can be
+// exercised in unit tests without requiring real mount(2) privileges.
+type mounter interface {
+	// bindMount bind mounts source onto target.
+	bindMount(source, target string) error
+	// bindRemount re-mounts an existing bind mount, optionally read-only.
+	bindRemount(target string, readOnly bool) error
+	// unmount tears down a previously created bind mount.
+	unmount(target string) error
+	// isMounted returns true if target is already a mount point.
+	isMounted(target string) (bool, error)
+}
+
+// bindMounter is the real mounter implementation, backed by the unix bind
+// mount syscalls and /proc/self/mountinfo.
+type bindMounter struct {
+	mountInfoPath string
+}
+
+func newBindMounter() mounter {
+	return &bindMounter{mountInfoPath: "/proc/self/mountinfo"}
+}
+
+func (b *bindMounter) bindMount(source, target string) error {
+	if err := unix.Mount(source, target, "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("error bind mounting %s to %s: %v", source, target, err)
+	}
+	return nil
+}
+
+func (b *bindMounter) bindRemount(target string, readOnly bool) error {
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT)
+	if readOnly {
+		flags |= unix.MS_RDONLY
+	}
+	if err := unix.Mount("", target, "", flags, ""); err != nil {
+		return fmt.Errorf("error remounting %s: %v", target, err)
+	}
+	return nil
+}
+
+func (b *bindMounter) unmount(target string) error {
+	if err := unix.Unmount(target, 0); err != nil {
+		return fmt.Errorf("error unmounting %s: %v", target, err)
+	}
+	return nil
+}
+
+// isMounted scans /proc/self/mountinfo for an entry whose mount point
+// matches target, so that a restarted diskmaker does not attempt to bind
+// mount on top of an existing mount.
+func (b *bindMounter) isMounted(target string) (bool, error) {
+	f, err := os.Open(b.mountInfoPath)
+	if err != nil {
+		return false, fmt.Errorf("error opening %s: %v", b.mountInfoPath, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// mountinfo format: ID parent major:minor root mountPoint ...
+		if len(fields) < 5 {
+			continue
+		}
+		if fields[4] == target {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("error scanning %s: %v", b.mountInfoPath, err)
+	}
+	return false, nil
+}
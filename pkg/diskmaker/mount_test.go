@@ -0,0 +1,149 @@
+package diskmaker
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	localv1 "github.com/openshift/local-storage-operator/pkg/apis/local/v1"
+
+	"github.com/openshift/local-storage-operator/pkg/diskmaker/safepath"
+)
+
+// fakeMounter is an in-memory mounter used to exercise symLinkDisks'
+// bind-mount path without touching real mount(2) syscalls.
+type fakeMounter struct {
+	mounted map[string]string
+}
+
+func newFakeMounter() *fakeMounter {
+	return &fakeMounter{mounted: map[string]string{}}
+}
+
+func (f *fakeMounter) bindMount(source, target string) error {
+	f.mounted[target] = source
+	return nil
+}
+
+func (f *fakeMounter) bindRemount(target string, readOnly bool) error {
+	return nil
+}
+
+func (f *fakeMounter) unmount(target string) error {
+	delete(f.mounted, target)
+	return nil
+}
+
+func (f *fakeMounter) isMounted(target string) (bool, error) {
+	_, ok := f.mounted[target]
+	return ok, nil
+}
+
+// fakeAPIUpdater is a no-op apiUpdater used so tests do not need a live
+// Kubernetes API server.
+type fakeAPIUpdater struct{}
+
+func (f *fakeAPIUpdater) recordEvent(lv *localv1.LocalVolume, eventType, reason, messageFmt string, args ...interface{}) {
+}
+
+func (f *fakeAPIUpdater) getLocalVolume(lv *localv1.LocalVolume) (*localv1.LocalVolume, error) {
+	return lv, nil
+}
+
+func newTestDiskMaker(t *testing.T, rootfsDir, symlinkLocation string) (*DiskMaker, *fakeMounter) {
+	t.Helper()
+	rootfs, err := safepath.Open(rootfsDir)
+	if err != nil {
+		t.Fatalf("error opening rootfs %s: %v", rootfsDir, err)
+	}
+	t.Cleanup(func() { rootfs.Close() })
+
+	if err := os.MkdirAll(symlinkLocation, 0755); err != nil {
+		t.Fatalf("error creating symlink location %s: %v", symlinkLocation, err)
+	}
+	symlinkRoot, err := safepath.Open(symlinkLocation)
+	if err != nil {
+		t.Fatalf("error opening symlink location %s: %v", symlinkLocation, err)
+	}
+	t.Cleanup(func() { symlinkRoot.Close() })
+
+	fm := newFakeMounter()
+	d := &DiskMaker{
+		symlinkLocation: symlinkLocation,
+		apiClient:       &fakeAPIUpdater{},
+		localVolume:     &localv1.LocalVolume{},
+		mounter:         fm,
+		rootfs:          rootfs,
+		symlinkRoot:     symlinkRoot,
+	}
+	d.eventSync = newEventReporter(d.apiClient)
+	return d, fm
+}
+
+func TestBindMountDirCreatesMount(t *testing.T) {
+	tmpDir := t.TempDir()
+	rootfsDir := path.Join(tmpDir, "rootfs")
+	if err := os.MkdirAll(path.Join(rootfsDir, "source"), 0755); err != nil {
+		t.Fatalf("error creating source dir: %v", err)
+	}
+
+	d, fm := newTestDiskMaker(t, rootfsDir, path.Join(tmpDir, "symlinks"))
+	relBindPath := path.Join("sc1", "local-shared-abc")
+	bindPath := path.Join(tmpDir, "symlinks", relBindPath)
+
+	d.bindMountDir("source", relBindPath)
+
+	source, ok := fm.mounted[bindPath]
+	if !ok {
+		t.Fatalf("expected %s to be bind mounted", bindPath)
+	}
+	if !strings.HasPrefix(source, "/proc/self/fd/") {
+		t.Fatalf("expected bind mount source to be a resolved proc fd path, got %s", source)
+	}
+}
+
+func TestBindMountDirSkipsAlreadyMounted(t *testing.T) {
+	tmpDir := t.TempDir()
+	rootfsDir := path.Join(tmpDir, "rootfs")
+	if err := os.MkdirAll(path.Join(rootfsDir, "source"), 0755); err != nil {
+		t.Fatalf("error creating source dir: %v", err)
+	}
+
+	d, fm := newTestDiskMaker(t, rootfsDir, path.Join(tmpDir, "symlinks"))
+	relBindPath := path.Join("sc1", "local-shared-abc")
+	bindPath := path.Join(tmpDir, "symlinks", relBindPath)
+	fm.mounted[bindPath] = "/some/other/source"
+
+	d.bindMountDir("source", relBindPath)
+
+	if fm.mounted[bindPath] != "/some/other/source" {
+		t.Fatalf("expected existing mount to be left untouched, got %s", fm.mounted[bindPath])
+	}
+}
+
+func TestBindMountDirRejectsSymlinkedStorageClassDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	rootfsDir := path.Join(tmpDir, "rootfs")
+	outside := t.TempDir()
+	if err := os.MkdirAll(path.Join(rootfsDir, "source"), 0755); err != nil {
+		t.Fatalf("error creating source dir: %v", err)
+	}
+
+	symlinkLocation := path.Join(tmpDir, "symlinks")
+	if err := os.MkdirAll(symlinkLocation, 0755); err != nil {
+		t.Fatalf("error creating symlink location: %v", err)
+	}
+	// Hostile tree: sc1 is actually a symlink pointing outside symlinkLocation.
+	if err := os.Symlink(outside, path.Join(symlinkLocation, "sc1")); err != nil {
+		t.Fatalf("error creating symlink fixture: %v", err)
+	}
+
+	d, _ := newTestDiskMaker(t, rootfsDir, symlinkLocation)
+
+	d.bindMountDir("source", path.Join("sc1", "local-shared-abc"))
+
+	if _, statErr := os.Stat(path.Join(outside, "local-shared-abc")); !os.IsNotExist(statErr) {
+		t.Fatalf("expected no bind target to be created outside symlinkLocation")
+	}
+}
@@ -0,0 +1,226 @@
+// Package safepath provides TOCTOU-safe path resolution for operations
+// that must stay confined to a root directory such as /rootfs, the host
+// filesystem bind-mounted into the diskmaker pod. Every component of a
+// relative path is opened with O_NOFOLLOW/AT_SYMLINK_NOFOLLOW so that a
+// symlink swapped in between a check and a later mount/symlink cannot
+// redirect the operation outside of root.
+package safepath
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// SafePath is opened once against a root directory. All further
+// operations take paths relative to that root and resolve every
+// component explicitly, rather than trusting a precomputed absolute
+// path that could have been altered since it was built.
+type SafePath struct {
+	root   string
+	rootFd int
+}
+
+// Open opens root, which is resolved normally since it is expected to be
+// a trusted mount point (e.g. /rootfs), and returns a SafePath confined
+// to it.
+func Open(root string) (*SafePath, error) {
+	fd, err := unix.Open(root, unix.O_DIRECTORY|unix.O_PATH, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error opening root %s: %v", root, err)
+	}
+	return &SafePath{root: root, rootFd: fd}, nil
+}
+
+// Close releases the root file descriptor.
+func (s *SafePath) Close() error {
+	return unix.Close(s.rootFd)
+}
+
+// cleanRel cleans rel and rejects anything that isn't confined to root:
+// an absolute path, or a path whose cleaned form is ".." or escapes
+// upward via a leading "../". filepath.Clean resolves ".." components
+// lexically, so any ".." surviving that pass can only mean the path
+// climbed above root itself - it must be rejected rather than handed to
+// openat, since O_NOFOLLOW blocks symlinks but happily traverses "..".
+func cleanRel(rel string) (string, error) {
+	rel = filepath.Clean(rel)
+	if filepath.IsAbs(rel) {
+		return "", fmt.Errorf("path %q must be relative to root", rel)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q escapes root", rel)
+	}
+	return rel, nil
+}
+
+// resolveDir opens the directory at rel (relative to root), following
+// each intermediate component with O_NOFOLLOW so a symlink substituted
+// along the way is rejected instead of followed. The caller owns the
+// returned file descriptor.
+func (s *SafePath) resolveDir(rel string) (int, error) {
+	rel, err := cleanRel(rel)
+	if err != nil {
+		return -1, err
+	}
+	if rel == "." || rel == "" || rel == string(filepath.Separator) {
+		return unix.Dup(s.rootFd)
+	}
+
+	dirFd := s.rootFd
+	owned := false
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "" || part == "." {
+			continue
+		}
+		childFd, err := unix.Openat(dirFd, part, unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_PATH, 0)
+		if owned {
+			unix.Close(dirFd)
+		}
+		if err != nil {
+			return -1, fmt.Errorf("error resolving %q: %w", part, err)
+		}
+		dirFd = childFd
+		owned = true
+	}
+	if !owned {
+		return unix.Dup(s.rootFd)
+	}
+	return dirFd, nil
+}
+
+// split resolves the parent directory of rel without following symlinks
+// and returns its file descriptor together with the final path element.
+func (s *SafePath) split(rel string) (dirFd int, base string, err error) {
+	cleaned, err := cleanRel(rel)
+	if err != nil {
+		return -1, "", err
+	}
+	dir, base := filepath.Split(cleaned)
+	dirFd, err = s.resolveDir(dir)
+	if err != nil {
+		return -1, "", err
+	}
+	if base == "" {
+		base = "."
+	}
+	return dirFd, base, nil
+}
+
+// Stat performs an AT_SYMLINK_NOFOLLOW stat of rel: every parent
+// component is resolved without following symlinks, and the final
+// component itself is not followed either.
+func (s *SafePath) Stat(rel string) (unix.Stat_t, error) {
+	dirFd, base, err := s.split(rel)
+	if err != nil {
+		return unix.Stat_t{}, err
+	}
+	defer unix.Close(dirFd)
+
+	var st unix.Stat_t
+	if err := unix.Fstatat(dirFd, base, &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return unix.Stat_t{}, fmt.Errorf("error statting %q: %w", rel, err)
+	}
+	return st, nil
+}
+
+// Exists reports whether rel exists, without following a symlink in its
+// final component.
+func (s *SafePath) Exists(rel string) bool {
+	_, err := s.Stat(rel)
+	return err == nil
+}
+
+// IsDir reports whether rel is a directory. A symlink at rel, even one
+// pointing at a directory, is not considered a directory.
+func (s *SafePath) IsDir(rel string) (bool, error) {
+	st, err := s.Stat(rel)
+	if err != nil {
+		if errors.Is(err, unix.ENOENT) {
+			return false, nil
+		}
+		return false, err
+	}
+	return st.Mode&unix.S_IFMT == unix.S_IFDIR, nil
+}
+
+// MkdirAll creates rel, and any missing parents, under root. Every
+// existing component must already be a directory reached without
+// following a symlink; a symlink anywhere on the path causes an error
+// instead of being followed.
+func (s *SafePath) MkdirAll(rel string, mode os.FileMode) error {
+	rel, err := cleanRel(rel)
+	if err != nil {
+		return err
+	}
+	if rel == "." || rel == "" {
+		return nil
+	}
+
+	dirFd := s.rootFd
+	owned := false
+	defer func() {
+		if owned {
+			unix.Close(dirFd)
+		}
+	}()
+
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "" || part == "." {
+			continue
+		}
+		if err := unix.Mkdirat(dirFd, part, uint32(mode)); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("error creating %q: %w", part, err)
+		}
+		childFd, err := unix.Openat(dirFd, part, unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_PATH, 0)
+		if err != nil {
+			return fmt.Errorf("error opening %q after mkdir: %w", part, err)
+		}
+		if owned {
+			unix.Close(dirFd)
+		}
+		dirFd = childFd
+		owned = true
+	}
+	return nil
+}
+
+// Symlink creates a symlink at rel (relative to root) pointing at
+// target. rel's parent directories are resolved without following
+// symlinks.
+func (s *SafePath) Symlink(target, rel string) error {
+	dirFd, base, err := s.split(rel)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(dirFd)
+
+	if err := unix.Symlinkat(target, dirFd, base); err != nil {
+		return fmt.Errorf("error creating symlink %q: %w", rel, err)
+	}
+	return nil
+}
+
+// ProcPath resolves rel to a /proc/self/fd path backed by an
+// O_PATH|O_NOFOLLOW descriptor opened on the final component. Passing
+// this path to operations such as mount(2) ensures they act on the exact
+// inode that was resolved, with no window for it to be swapped out from
+// under the caller afterwards. The returned close func must be called
+// once the caller is done with the path.
+func (s *SafePath) ProcPath(rel string) (procPath string, closeFd func() error, err error) {
+	dirFd, base, err := s.split(rel)
+	if err != nil {
+		return "", nil, err
+	}
+	defer unix.Close(dirFd)
+
+	fd, err := unix.Openat(dirFd, base, unix.O_NOFOLLOW|unix.O_PATH, 0)
+	if err != nil {
+		return "", nil, fmt.Errorf("error resolving %q: %w", rel, err)
+	}
+	return fmt.Sprintf("/proc/self/fd/%d", fd), func() error { return unix.Close(fd) }, nil
+}
@@ -0,0 +1,138 @@
+package safepath
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMkdirAllAndIsDir(t *testing.T) {
+	root := t.TempDir()
+	sp, err := Open(root)
+	if err != nil {
+		t.Fatalf("unexpected error opening root: %v", err)
+	}
+	defer sp.Close()
+
+	if err := sp.MkdirAll("a/b/c", 0755); err != nil {
+		t.Fatalf("unexpected error creating a/b/c: %v", err)
+	}
+
+	isDir, err := sp.IsDir("a/b/c")
+	if err != nil {
+		t.Fatalf("unexpected error checking a/b/c: %v", err)
+	}
+	if !isDir {
+		t.Fatalf("expected a/b/c to be a directory")
+	}
+}
+
+func TestIsDirDoesNotFollowSymlinkAtLeaf(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatalf("unexpected error creating symlink fixture: %v", err)
+	}
+
+	sp, err := Open(root)
+	if err != nil {
+		t.Fatalf("unexpected error opening root: %v", err)
+	}
+	defer sp.Close()
+
+	isDir, err := sp.IsDir("escape")
+	if err != nil {
+		t.Fatalf("unexpected error checking escape: %v", err)
+	}
+	if isDir {
+		t.Fatalf("expected symlink at leaf not to be reported as a directory")
+	}
+}
+
+func TestMkdirAllRejectsSymlinkedParent(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	// Hostile tree: sharedDir/foo -> /etc (here, an arbitrary directory
+	// outside root) so that a naive os.MkdirAll would create content
+	// inside `outside` instead of `root`.
+	if err := os.MkdirAll(filepath.Join(root, "sharedDir"), 0755); err != nil {
+		t.Fatalf("unexpected error creating sharedDir: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "sharedDir", "foo")); err != nil {
+		t.Fatalf("unexpected error creating symlink fixture: %v", err)
+	}
+
+	sp, err := Open(root)
+	if err != nil {
+		t.Fatalf("unexpected error opening root: %v", err)
+	}
+	defer sp.Close()
+
+	err = sp.MkdirAll("sharedDir/foo/bar", 0755)
+	if err == nil {
+		t.Fatalf("expected MkdirAll to reject a symlinked parent component")
+	}
+
+	if _, statErr := os.Stat(filepath.Join(outside, "bar")); !os.IsNotExist(statErr) {
+		t.Fatalf("expected no directory to be created outside root, got stat err: %v", statErr)
+	}
+}
+
+func TestMkdirAllRejectsDotDotEscape(t *testing.T) {
+	root := t.TempDir()
+	parent := filepath.Dir(root)
+
+	sp, err := Open(root)
+	if err != nil {
+		t.Fatalf("unexpected error opening root: %v", err)
+	}
+	defer sp.Close()
+
+	escapeName := "escaped-" + filepath.Base(root)
+	if err := sp.MkdirAll("../"+escapeName, 0755); err == nil {
+		t.Fatalf("expected MkdirAll to reject a path that escapes root via ..")
+	}
+
+	if _, statErr := os.Stat(filepath.Join(parent, escapeName)); !os.IsNotExist(statErr) {
+		t.Fatalf("expected no directory to be created outside root, got stat err: %v", statErr)
+	}
+}
+
+func TestMkdirAllRejectsDotDotInMiddleOfPath(t *testing.T) {
+	root := t.TempDir()
+
+	sp, err := Open(root)
+	if err != nil {
+		t.Fatalf("unexpected error opening root: %v", err)
+	}
+	defer sp.Close()
+
+	if err := sp.MkdirAll("a/../../etc", 0755); err == nil {
+		t.Fatalf("expected MkdirAll to reject a path that climbs above root via an embedded ..")
+	}
+}
+
+func TestSymlinkRejectsSymlinkedParent(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.Symlink(outside, filepath.Join(root, "foo")); err != nil {
+		t.Fatalf("unexpected error creating symlink fixture: %v", err)
+	}
+
+	sp, err := Open(root)
+	if err != nil {
+		t.Fatalf("unexpected error opening root: %v", err)
+	}
+	defer sp.Close()
+
+	if err := sp.Symlink("/dev/sda", "foo/bar"); err == nil {
+		t.Fatalf("expected Symlink to reject a symlinked parent component")
+	}
+
+	if _, statErr := os.Lstat(filepath.Join(outside, "bar")); !os.IsNotExist(statErr) {
+		t.Fatalf("expected no symlink to be created outside root, got stat err: %v", statErr)
+	}
+}
@@ -0,0 +1,93 @@
+package diskmaker
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+// newSyntheticDiskTree builds a fake /dev, /dev/disk/by-id and
+// /dev/disk/by-path tree rooted at a temp dir, so findStableDeviceID and
+// findDeviceByID can be exercised without real hardware.
+func newSyntheticDiskTree(t *testing.T) (root string, byID, byPath string) {
+	t.Helper()
+	root = t.TempDir()
+
+	devDir := path.Join(root, "dev")
+	byID = path.Join(root, "dev", "disk", "by-id")
+	byPath = path.Join(root, "dev", "disk", "by-path")
+	for _, dir := range []string{devDir, byID, byPath} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("error creating %s: %v", dir, err)
+		}
+	}
+
+	if err := os.WriteFile(path.Join(devDir, "sda"), nil, 0644); err != nil {
+		t.Fatalf("error creating fake device: %v", err)
+	}
+
+	symlink := func(linkDir, name string) {
+		if err := os.Symlink(path.Join(devDir, "sda"), path.Join(linkDir, name)); err != nil {
+			t.Fatalf("error creating symlink %s: %v", name, err)
+		}
+	}
+	symlink(byID, "scsi-0001")
+	symlink(byID, "wwn-0x5000")
+	symlink(byPath, "pci-0000:00:01.0-scsi-0")
+
+	return root, byID, byPath
+}
+
+func TestFindStableDeviceIDPrefersWWN(t *testing.T) {
+	_, byID, byPath := newSyntheticDiskTree(t)
+
+	allDisks := []string{
+		path.Join(byID, "scsi-0001"),
+		path.Join(byID, "wwn-0x5000"),
+		path.Join(byPath, "pci-0000:00:01.0-scsi-0"),
+	}
+
+	got, err := (&DiskMaker{}).findStableDeviceID("sda", allDisks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := path.Join(byID, "wwn-0x5000")
+	if got != want {
+		t.Fatalf("expected wwn- entry %s to be preferred, got %s", want, got)
+	}
+}
+
+func TestFindStableDeviceIDFallsBackToByPath(t *testing.T) {
+	_, _, byPath := newSyntheticDiskTree(t)
+
+	allDisks := []string{path.Join(byPath, "pci-0000:00:01.0-scsi-0")}
+
+	got, err := (&DiskMaker{}).findStableDeviceID("sda", allDisks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != allDisks[0] {
+		t.Fatalf("expected by-path entry to be returned when it is the only match, got %s", got)
+	}
+}
+
+func TestFindDeviceByIDSearchesRootsInOrder(t *testing.T) {
+	_, byID, byPath := newSyntheticDiskTree(t)
+
+	d := &DiskMaker{stableIDRoots: []string{byID, byPath}}
+
+	resolvedID, devicePath, err := d.findDeviceByID("wwn-0x5000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolvedID != path.Join(byID, "wwn-0x5000") {
+		t.Fatalf("expected resolved id under by-id, got %s", resolvedID)
+	}
+	if path.Base(devicePath) != "sda" {
+		t.Fatalf("expected resolved device sda, got %s", devicePath)
+	}
+
+	if _, _, err := d.findDeviceByID("pci-0000:00:01.0-scsi-0"); err != nil {
+		t.Fatalf("expected by-path-only id to resolve, got error: %v", err)
+	}
+}
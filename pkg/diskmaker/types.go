@@ -0,0 +1,44 @@
+package diskmaker
+
+import "k8s.io/apimachinery/pkg/util/sets"
+
+// DiskConfig is parsed from the configmap mounted into the diskmaker pod. It
+// describes, per storage class, which devices, directories and files should
+// be claimed on this node.
+type DiskConfig struct {
+	Disks           map[string]Disks `json:"disks"`
+	OwnerName       string           `json:"ownerName"`
+	OwnerNamespace  string           `json:"ownerNamespace"`
+	OwnerKind       string           `json:"ownerKind"`
+	OwnerAPIVersion string           `json:"ownerApiVersion"`
+	// StableDeviceIDRoots orders the /dev/disk/by-* directories searched
+	// for a stable identifier for a device. Defaults to by-id then
+	// by-path when empty.
+	StableDeviceIDRoots []string `json:"stableDeviceIDRoots,omitempty"`
+}
+
+// Disks lists the device names, device IDs, shared directories and
+// file-backed loop devices that should be claimed for a storage class.
+type Disks struct {
+	DevicePaths    []string `json:"devicePaths,omitempty"`
+	DeviceIDPaths  []string `json:"deviceIDs,omitempty"`
+	DirectoryPaths []string `json:"directoryPaths,omitempty"`
+	// FilePaths are regular files under /rootfs that should be backed by a
+	// loop device and then treated as a block device.
+	FilePaths []string `json:"filePaths,omitempty"`
+	// ForceWipe opts a storage class out of the filesystem/signature
+	// pre-flight check, allowing a device that already carries data to be
+	// claimed anyway. Defaults to false so devices are never claimed
+	// (and implicitly wiped by the provisioner) by accident.
+	ForceWipe bool `json:"forceWipe,omitempty"`
+}
+
+// DeviceNames returns the configured device paths as a set.
+func (d Disks) DeviceNames() sets.String {
+	return sets.NewString(d.DevicePaths...)
+}
+
+// DeviceIDs returns the configured device IDs as a set.
+func (d Disks) DeviceIDs() sets.String {
+	return sets.NewString(d.DeviceIDPaths...)
+}